@@ -0,0 +1,120 @@
+// Package renewer provides a helper, analogous to Vault's api/renewer.go,
+// that publishers can embed to keep a gateway lease alive for the duration
+// of a long-running ingestion without having to acquire it for the whole
+// upload up front.
+package renewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RenewOutput is sent on RenewCh every time the lease is successfully renewed
+type RenewOutput struct {
+	RenewedAt time.Time
+	TTL       time.Duration
+}
+
+// Renewer periodically renews a gateway lease in the background
+type Renewer struct {
+	client     *http.Client
+	gatewayURL string
+	leaseToken string
+	ttl        time.Duration
+
+	RenewCh chan *RenewOutput
+	DoneCh  chan error
+
+	stopCh chan struct{}
+}
+
+// New creates a Renewer for the lease identified by leaseToken, which was
+// granted with the given initial TTL. gatewayURL is the base URL of the
+// gateway (e.g. "https://gw.example.org/api/v1").
+func New(gatewayURL, leaseToken string, ttl time.Duration) *Renewer {
+	return &Renewer{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		gatewayURL: gatewayURL,
+		leaseToken: leaseToken,
+		ttl:        ttl,
+		RenewCh:    make(chan *RenewOutput),
+		DoneCh:     make(chan error, 1),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Renew starts the background renewal loop. It renews the lease at 2/3 of
+// its remaining TTL, stopping when Stop is called or when a renewal attempt
+// fails - the server indicating the lease is no longer renewable, or a
+// request or decoding error - in which case the error is sent on DoneCh.
+// Nothing is sent on DoneCh when the loop ends through Stop.
+func (r *Renewer) Renew() {
+	go r.run()
+}
+
+// Stop terminates the renewal loop. It is safe to call more than once.
+func (r *Renewer) Stop() {
+	select {
+	case <-r.stopCh:
+	default:
+		close(r.stopCh)
+	}
+}
+
+func (r *Renewer) run() {
+	ttl := r.ttl
+	for {
+		wait := ttl * 2 / 3
+		select {
+		case <-r.stopCh:
+			return
+		case <-time.After(wait):
+		}
+
+		newTTL, err := r.renewOnce()
+		if err != nil {
+			r.DoneCh <- err
+			return
+		}
+
+		ttl = newTTL
+		select {
+		case r.RenewCh <- &RenewOutput{RenewedAt: time.Now(), TTL: ttl}:
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+func (r *Renewer) renewOnce() (time.Duration, error) {
+	body, err := json.Marshal(map[string]string{"extend": r.ttl.String()})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not marshal renew request")
+	}
+
+	url := fmt.Sprintf("%s/leases/%s/renew", r.gatewayURL, r.leaseToken)
+	resp, err := r.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "renew request failed")
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return 0, errors.Wrap(err, "could not decode renew response")
+	}
+
+	if reply.Status != "ok" {
+		return 0, errors.Errorf("lease not renewable: %v", reply.Reason)
+	}
+
+	return r.ttl, nil
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Format selects how an Entry is serialized before being handed to a sink's
+// underlying transport
+type Format string
+
+// The two supported entry formats
+const (
+	FormatJSON Format = "json"
+	FormatLine Format = "line"
+)
+
+func formatEntry(format Format, entry *Entry) ([]byte, error) {
+	switch format {
+	case "", FormatJSON:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not marshal audit entry")
+		}
+		return data, nil
+	case FormatLine:
+		line := fmt.Sprintf(
+			"time=%q request_id=%q key_id=%q remote_addr=%q method=%q path=%q repository=%q lease_token=%q hmac_valid=%t result=%q",
+			entry.Time.Format("2006-01-02T15:04:05.000Z07:00"), entry.RequestID, entry.KeyID, entry.RemoteAddr,
+			entry.Method, entry.Path, entry.Repository, entry.LeaseToken, entry.HMACValid, entry.Result)
+		return []byte(line), nil
+	default:
+		return nil, errors.Errorf("unknown audit entry format: %v", format)
+	}
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileSink appends one audit entry per request/response event to a local
+// file, one entry per line
+type FileSink struct {
+	format Format
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (creating if necessary) path for appending and returns a
+// FileSink that writes entries to it in the given format
+func NewFileSink(path string, format Format) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open audit log file: %v", path)
+	}
+	return &FileSink{format: format, file: f}, nil
+}
+
+// WriteRequest implements the Sink interface
+func (s *FileSink) WriteRequest(ctx context.Context, entry *Entry) error {
+	return s.write(entry)
+}
+
+// WriteResponse implements the Sink interface
+func (s *FileSink) WriteResponse(ctx context.Context, entry *Entry) error {
+	return s.write(entry)
+}
+
+func (s *FileSink) write(entry *Entry) error {
+	data, err := formatEntry(s.format, entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the underlying file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
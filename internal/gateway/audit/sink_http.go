@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPSink posts each audit entry as a webhook to a configured endpoint
+type HTTPSink struct {
+	endpoint string
+	format   Format
+	client   *http.Client
+}
+
+// NewHTTPSink returns an HTTPSink posting entries to endpoint in the given
+// format
+func NewHTTPSink(endpoint string, format Format) *HTTPSink {
+	return &HTTPSink{endpoint: endpoint, format: format, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// WriteRequest implements the Sink interface
+func (s *HTTPSink) WriteRequest(ctx context.Context, entry *Entry) error {
+	return s.write(ctx, entry)
+}
+
+// WriteResponse implements the Sink interface
+func (s *HTTPSink) WriteResponse(ctx context.Context, entry *Entry) error {
+	return s.write(ctx, entry)
+}
+
+func (s *HTTPSink) write(ctx context.Context, entry *Entry) error {
+	data, err := formatEntry(s.format, entry)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "could not create audit webhook request")
+	}
+	if s.format == "" || s.format == FormatJSON {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "audit webhook request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("audit webhook returned status %v", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// +build !windows
+
+package audit
+
+import (
+	"context"
+	"log/syslog"
+
+	"github.com/pkg/errors"
+)
+
+// SyslogSink forwards audit entries to the local or a remote syslog daemon
+type SyslogSink struct {
+	format Format
+	writer *syslog.Writer
+}
+
+// NewSyslogSink dials network/raddr (both empty for the local syslog daemon)
+// and returns a SyslogSink writing entries in the given format
+func NewSyslogSink(network, raddr string, format Format) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_AUTH, "cvmfs-gateway-audit")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to syslog")
+	}
+	return &SyslogSink{format: format, writer: w}, nil
+}
+
+// WriteRequest implements the Sink interface
+func (s *SyslogSink) WriteRequest(ctx context.Context, entry *Entry) error {
+	return s.write(entry)
+}
+
+// WriteResponse implements the Sink interface
+func (s *SyslogSink) WriteResponse(ctx context.Context, entry *Entry) error {
+	return s.write(entry)
+}
+
+func (s *SyslogSink) write(entry *Entry) error {
+	data, err := formatEntry(s.format, entry)
+	if err != nil {
+		return err
+	}
+	return s.writer.Info(string(data))
+}
+
+// Close closes the underlying syslog connection
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"github.com/pkg/errors"
+
+	gw "github.com/cvmfs/gateway/internal/gateway"
+	"github.com/cvmfs/gateway/internal/gateway/audit"
+)
+
+// NewAuditDispatcher builds an audit.Dispatcher from the sinks enabled in
+// cfg.Audit
+func NewAuditDispatcher(cfg *gw.Config) (*audit.Dispatcher, error) {
+	var sinks []audit.Sink
+
+	if cfg.Audit.File.Enabled {
+		sink, err := audit.NewFileSink(cfg.Audit.File.Path, audit.Format(cfg.Audit.File.Format))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create file audit sink")
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.Audit.Syslog.Enabled {
+		sink, err := audit.NewSyslogSink(cfg.Audit.Syslog.Network, cfg.Audit.Syslog.Address, audit.Format(cfg.Audit.Syslog.Format))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create syslog audit sink")
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.Audit.HTTP.Enabled {
+		sinks = append(sinks, audit.NewHTTPSink(cfg.Audit.HTTP.Endpoint, audit.Format(cfg.Audit.HTTP.Format)))
+	}
+
+	return audit.NewDispatcher(cfg.Audit.KeyIDSalt, sinks...), nil
+}
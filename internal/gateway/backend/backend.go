@@ -2,14 +2,20 @@ package backend
 
 import (
 	gw "github.com/cvmfs/gateway/internal/gateway"
+	"github.com/cvmfs/gateway/internal/gateway/audit"
 	"github.com/pkg/errors"
 )
 
 // Services is a container for the various
 // backend services
 type Services struct {
-	Access AccessConfig
-	Leases LeaseDB
+	Access        AccessConfig
+	Leases        LeaseDB
+	Secrets       SecretProvider
+	PreAuth       PreAuthorizer
+	Audit         *audit.Dispatcher
+	Tokens        TokenVerifier
+	RenewalPolicy *LeaseRenewalPolicy
 }
 
 // Start initializes the various backend services
@@ -30,5 +36,31 @@ func Start(cfg *gw.Config) (*Services, error) {
 			err, "could not create lease DB")
 	}
 
-	return &Services{Access: ac, Leases: ldb}, nil
+	sp, err := NewSecretProvider(cfg, &ac)
+	if err != nil {
+		return nil, errors.Wrap(
+			err, "could not create secret provider")
+	}
+
+	pa, err := NewPreAuthorizer(cfg)
+	if err != nil {
+		return nil, errors.Wrap(
+			err, "could not create pre-authorizer")
+	}
+
+	ad, err := NewAuditDispatcher(cfg)
+	if err != nil {
+		return nil, errors.Wrap(
+			err, "could not create audit dispatcher")
+	}
+
+	tv, err := NewTokenVerifier(cfg)
+	if err != nil {
+		return nil, errors.Wrap(
+			err, "could not create token verifier")
+	}
+
+	rp := NewLeaseRenewalPolicy(cfg)
+
+	return &Services{Access: ac, Leases: ldb, Secrets: sp, PreAuth: pa, Audit: ad, Tokens: tv, RenewalPolicy: rp}, nil
 }
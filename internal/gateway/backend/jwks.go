@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// jwksDocument is the subset of RFC 7517 JWK Set fields the gateway needs
+type jwksDocument struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// fetchJWKS retrieves and parses the JWKS document at url, returning the RSA
+// public keys it contains indexed by key ID
+func fetchJWKS(url string) (map[string]interface{}, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch JWKS")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("JWKS endpoint returned status %v", resp.StatusCode)
+	}
+
+	var doc jwksDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "could not decode JWKS document")
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		key, err := jwkToRSAPublicKey(k.N, k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse JWKS key %v", k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func jwkToRSAPublicKey(nStr, eStr string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(nStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid modulus")
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(eStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid exponent")
+	}
+	if len(eBytes) > 8 {
+		return nil, errors.Errorf("exponent is too large: %v bytes", len(eBytes))
+	}
+
+	eBytesPadded := make([]byte, 8)
+	copy(eBytesPadded[8-len(eBytes):], eBytes)
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(binary.BigEndian.Uint64(eBytesPadded)),
+	}, nil
+}
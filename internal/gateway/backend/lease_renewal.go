@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"time"
+
+	gw "github.com/cvmfs/gateway/internal/gateway"
+)
+
+// RenewableLeaseDB is implemented by LeaseDB backends that support extending
+// the lifetime of an already-granted lease. It is kept separate from LeaseDB
+// itself so that existing LeaseDB implementations are unaffected by its
+// addition; callers that need renewal type-assert for it explicitly and
+// degrade gracefully when it isn't supported.
+type RenewableLeaseDB interface {
+	// RenewLease extends the expiration of the lease identified by token by
+	// extend, measured from now
+	RenewLease(token string, extend time.Duration) error
+	// LeasePath returns the repository path the given lease token was
+	// issued for, so that callers can re-check it against a PreAuthDecision
+	// or LeaseRenewalPolicy before renewing
+	LeasePath(token string) (string, error)
+}
+
+// LeaseRenewalPolicy bounds how far a single renewal request may extend a
+// lease's lifetime, overall and per repository.
+type LeaseRenewalPolicy struct {
+	// MaxLifetime caps the extension granted by a single renewal request.
+	// Zero means unbounded.
+	MaxLifetime time.Duration
+	// PerRepositoryMaxLifetime overrides MaxLifetime for specific
+	// repositories.
+	PerRepositoryMaxLifetime map[string]time.Duration
+}
+
+// MaxLifetimeFor returns the policy's maximum renewal extension for
+// repository, falling back to MaxLifetime when no per-repository override is
+// configured.
+func (p *LeaseRenewalPolicy) MaxLifetimeFor(repository string) time.Duration {
+	if d, ok := p.PerRepositoryMaxLifetime[repository]; ok {
+		return d
+	}
+	return p.MaxLifetime
+}
+
+// NewLeaseRenewalPolicy builds a LeaseRenewalPolicy from cfg
+func NewLeaseRenewalPolicy(cfg *gw.Config) *LeaseRenewalPolicy {
+	return &LeaseRenewalPolicy{
+		MaxLifetime:              cfg.LeaseRenewal.MaxLifetime,
+		PerRepositoryMaxLifetime: cfg.LeaseRenewal.PerRepositoryMaxLifetime,
+	}
+}
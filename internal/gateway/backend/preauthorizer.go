@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	gw "github.com/cvmfs/gateway/internal/gateway"
+)
+
+// PreAuthRequest describes the inbound request being checked against the
+// external policy service, before the local HMAC-derived authorization is
+// allowed to proceed
+type PreAuthRequest struct {
+	Method     string `json:"method"`
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+	KeyID      string `json:"key_id"`
+	LeasePath  string `json:"lease_path"`
+	RequestID  string `json:"request_id"`
+}
+
+// PreAuthDecision is the outcome of a pre-authorization check. Paths
+// constrains the lease/payload/commit operation to the given subtree(s) of
+// the repository. MaxLeaseTime is the lease-time cap returned by the
+// service; it is carried on the decision, but no gateway handler applies it
+// to the leases it grants.
+type PreAuthDecision struct {
+	Paths        []string      `json:"paths"`
+	MaxLeaseTime time.Duration `json:"max_lease_time"`
+}
+
+// PathAllowed reports whether path falls within one of the decision's
+// allowed path prefixes. An empty Paths list is unconstrained, matching the
+// noop provider's behavior of granting full access.
+func (d *PreAuthDecision) PathAllowed(path string) bool {
+	if len(d.Paths) == 0 {
+		return true
+	}
+	for _, allowed := range d.Paths {
+		if path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// PreAuthorizer is the interface implemented by pluggable pre-authorization
+// backends. Authorize is called, after the local HMAC check has already
+// succeeded, with a descriptor of the request; a non-nil error or a nil
+// decision means the request must be rejected.
+type PreAuthorizer interface {
+	Authorize(req PreAuthRequest) (*PreAuthDecision, error)
+}
+
+// NewPreAuthorizer constructs the PreAuthorizer selected by cfg.PreAuthorizer.Type,
+// defaulting to the noop provider which preserves today's behavior of allowing
+// any request that already passed the local HMAC check
+func NewPreAuthorizer(cfg *gw.Config) (PreAuthorizer, error) {
+	switch cfg.PreAuthorizer.Type {
+	case "", "noop":
+		return &noopPreAuthorizer{}, nil
+	case "http":
+		return NewHTTPPreAuthorizer(cfg.PreAuthorizer.HTTP), nil
+	default:
+		return nil, errors.Errorf("unknown pre-authorizer type: %v", cfg.PreAuthorizer.Type)
+	}
+}
+
+// noopPreAuthorizer grants unconstrained access to every request, matching
+// the gateway's behavior before pre-authorization was introduced
+type noopPreAuthorizer struct{}
+
+// Authorize implements the PreAuthorizer interface
+func (noopPreAuthorizer) Authorize(req PreAuthRequest) (*PreAuthDecision, error) {
+	return &PreAuthDecision{}, nil
+}
+
+type preAuthCacheEntry struct {
+	decision *PreAuthDecision
+	expires  time.Time
+}
+
+type preAuthCacheKey struct {
+	keyID string
+	path  string
+}
+
+// HTTPPreAuthorizer delegates the authorization decision to an external HTTP
+// service, analogous to how gitlab-workhorse asks Rails whether to serve a
+// request. Decisions are cached briefly, keyed on (keyID, path), to keep the
+// common path fast.
+type HTTPPreAuthorizer struct {
+	cfg    gw.HTTPPreAuthorizerConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[preAuthCacheKey]preAuthCacheEntry
+}
+
+// NewHTTPPreAuthorizer builds an HTTPPreAuthorizer from cfg
+func NewHTTPPreAuthorizer(cfg gw.HTTPPreAuthorizerConfig) *HTTPPreAuthorizer {
+	return &HTTPPreAuthorizer{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cache:  make(map[preAuthCacheKey]preAuthCacheEntry),
+	}
+}
+
+// Authorize implements the PreAuthorizer interface
+func (p *HTTPPreAuthorizer) Authorize(req PreAuthRequest) (*PreAuthDecision, error) {
+	key := preAuthCacheKey{keyID: req.KeyID, path: req.Path}
+
+	p.mu.Lock()
+	entry, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.decision, nil
+	}
+
+	decision, err := p.query(req)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cache[key] = preAuthCacheEntry{decision: decision, expires: time.Now().Add(p.cfg.CacheTTL)}
+	p.mu.Unlock()
+
+	return decision, nil
+}
+
+func (p *HTTPPreAuthorizer) query(req PreAuthRequest) (*PreAuthDecision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal pre-authorization request")
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, p.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create pre-authorization request")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "pre-authorization request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("pre-authorization service returned status %v", resp.StatusCode)
+	}
+
+	var decision PreAuthDecision
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return nil, errors.Wrap(err, "could not decode pre-authorization response")
+	}
+
+	return &decision, nil
+}
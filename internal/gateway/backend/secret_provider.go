@@ -0,0 +1,207 @@
+package backend
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+
+	gw "github.com/cvmfs/gateway/internal/gateway"
+)
+
+// validKeyID matches the key IDs the gateway itself issues (see AccessConfig).
+// fetch relies on it to reject a client-supplied keyID containing path
+// traversal segments ("../") before using it to build a Vault read path.
+var validKeyID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// SecretProvider is the interface implemented by the various backends capable
+// of resolving a repository key ID to its HMAC secret. Implementations are
+// free to cache results internally, but must be safe for concurrent use.
+type SecretProvider interface {
+	// GetSecret returns the HMAC secret associated with keyID, or nil if the
+	// key ID is not known to the provider
+	GetSecret(keyID string) []byte
+	// Reload refreshes any cached state held by the provider
+	Reload() error
+}
+
+// NewSecretProvider constructs the SecretProvider selected by cfg.SecretProvider.Type,
+// falling back to the file-backed provider (reusing the already-loaded AccessConfig)
+// when no type is configured
+func NewSecretProvider(cfg *gw.Config, ac *AccessConfig) (SecretProvider, error) {
+	switch cfg.SecretProvider.Type {
+	case "", "file":
+		return &fileSecretProvider{ac}, nil
+	case "vault":
+		return NewVaultSecretProvider(cfg.SecretProvider.Vault, ac)
+	default:
+		return nil, errors.Errorf("unknown secret provider type: %v", cfg.SecretProvider.Type)
+	}
+}
+
+// fileSecretProvider is the default SecretProvider, backed by the keys already
+// present in the repository access configuration file
+type fileSecretProvider struct {
+	ac *AccessConfig
+}
+
+// GetSecret implements the SecretProvider interface
+func (p *fileSecretProvider) GetSecret(keyID string) []byte {
+	return p.ac.GetSecret(keyID)
+}
+
+// Reload implements the SecretProvider interface. The file-backed access
+// configuration already watches its source file for changes, so there is
+// nothing additional to refresh here.
+func (p *fileSecretProvider) Reload() error {
+	return nil
+}
+
+type vaultCacheEntry struct {
+	secret  []byte
+	expires time.Time
+}
+
+// VaultSecretProvider resolves key secrets from a HashiCorp Vault KV store, so
+// that HMAC keys can be rotated centrally without redeploying the gateway or
+// re-syncing repo.gw access configuration files
+type VaultSecretProvider struct {
+	cfg    gw.VaultConfig
+	client *vaultapi.Client
+	ac     *AccessConfig
+
+	mu    sync.Mutex
+	cache map[string]vaultCacheEntry
+}
+
+// NewVaultSecretProvider builds a VaultSecretProvider from cfg, authenticating
+// against the Vault server using either AppRole (when RoleID is set) or the
+// configured static token. ac is kept as a fallback for key IDs which are
+// present in the local access configuration but not yet migrated to Vault.
+func NewVaultSecretProvider(cfg gw.VaultConfig, ac *AccessConfig) (*VaultSecretProvider, error) {
+	vc := vaultapi.DefaultConfig()
+	vc.Address = cfg.Address
+	if cfg.CACert != "" {
+		if err := vc.ConfigureTLS(&vaultapi.TLSConfig{CACert: cfg.CACert}); err != nil {
+			return nil, errors.Wrap(err, "could not configure Vault TLS")
+		}
+	}
+
+	client, err := vaultapi.NewClient(vc)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Vault client")
+	}
+
+	p := &VaultSecretProvider{cfg: cfg, client: client, ac: ac, cache: make(map[string]vaultCacheEntry)}
+
+	if err := p.authenticate(); err != nil {
+		return nil, errors.Wrap(err, "could not authenticate to Vault")
+	}
+
+	return p, nil
+}
+
+func (p *VaultSecretProvider) authenticate() error {
+	if p.cfg.RoleID != "" {
+		secret, err := p.client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   p.cfg.RoleID,
+			"secret_id": p.cfg.SecretID,
+		})
+		if err != nil {
+			return errors.Wrap(err, "AppRole login failed")
+		}
+		p.client.SetToken(secret.Auth.ClientToken)
+		return nil
+	}
+
+	if p.cfg.Token != "" {
+		p.client.SetToken(p.cfg.Token)
+		return nil
+	}
+
+	return errors.New("vault secret provider requires either role_id/secret_id or a token")
+}
+
+// GetSecret implements the SecretProvider interface. Secrets are cached for
+// cfg.CacheTTL and refreshed from Vault on a cache miss or expiry.
+func (p *VaultSecretProvider) GetSecret(keyID string) []byte {
+	p.mu.Lock()
+	entry, ok := p.cache[keyID]
+	p.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.secret
+	}
+
+	secret, err := p.fetch(keyID)
+	if err != nil {
+		gw.Log.Error().
+			Str("component", "secret_provider").
+			Str("key_id", keyID).
+			Err(err).Msg("could not read secret from Vault")
+		// Fall back to the local access configuration, if present, rather
+		// than failing authorization outright on a transient Vault error
+		return p.ac.GetSecret(keyID)
+	}
+
+	p.mu.Lock()
+	p.cache[keyID] = vaultCacheEntry{secret: secret, expires: time.Now().Add(p.cfg.CacheTTL)}
+	p.mu.Unlock()
+
+	return secret
+}
+
+func (p *VaultSecretProvider) fetch(keyID string) ([]byte, error) {
+	if !validKeyID.MatchString(keyID) {
+		return nil, errors.Errorf("invalid key ID: %v", keyID)
+	}
+
+	path := p.cfg.Mount + "/" + p.cfg.KeyPathPrefix + "/" + keyID
+	kv, err := p.client.Logical().Read(path)
+	if isPermissionDenied(err) {
+		// The AppRole/token login used at startup is normally short-lived;
+		// once it expires every read fails with permission denied. Re-login
+		// once and retry, rather than silently falling back to the stale
+		// file-backed AccessConfig for the rest of the process's lifetime.
+		if authErr := p.authenticate(); authErr != nil {
+			return nil, errors.Wrap(authErr, "Vault re-authentication failed")
+		}
+		kv, err = p.client.Logical().Read(path)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Vault read failed")
+	}
+	if kv == nil || kv.Data == nil {
+		return nil, errors.Errorf("no secret found at %v", path)
+	}
+
+	data, ok := kv.Data["data"].(map[string]interface{})
+	if !ok {
+		// KV v1 mounts return the value directly under Data
+		data = kv.Data
+	}
+
+	secret, ok := data["secret"].(string)
+	if !ok {
+		return nil, errors.Errorf("secret at %v is missing the \"secret\" field", path)
+	}
+
+	return []byte(secret), nil
+}
+
+// Reload clears the in-memory cache, forcing the next GetSecret call for each
+// key to be served fresh from Vault
+func (p *VaultSecretProvider) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cache = make(map[string]vaultCacheEntry)
+	return nil
+}
+
+// isPermissionDenied reports whether err is the Vault API's response to an
+// expired or otherwise invalid client token
+func isPermissionDenied(err error) bool {
+	respErr, ok := err.(*vaultapi.ResponseError)
+	return ok && respErr.StatusCode == 403
+}
@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	gw "github.com/cvmfs/gateway/internal/gateway"
+)
+
+// Principal is the authenticated identity derived from a request, regardless
+// of whether it was established via the legacy HMAC scheme or a JWT bearer
+// token. Downstream handlers should consult this struct rather than the
+// scheme-specific details that produced it.
+type Principal struct {
+	// KeyID identifies the caller. For the HMAC scheme this is the AccessConfig
+	// key ID; for JWTs this is the token's "sub" claim.
+	KeyID string
+	// Repos lists the repositories the principal may act on, or is empty if
+	// the scheme does not constrain by repository (e.g. HMAC, where the
+	// AccessConfig entry for KeyID already encodes this).
+	Repos []string
+	// Paths lists the lease path prefixes the principal may act on, or is
+	// empty if unconstrained.
+	Paths []string
+}
+
+// RepoAllowed reports whether repository is one the principal may act on. An
+// empty Repos list is unconstrained, matching the HMAC scheme's behavior of
+// deferring entirely to the AccessConfig entry for KeyID.
+func (p *Principal) RepoAllowed(repository string) bool {
+	if len(p.Repos) == 0 {
+		return true
+	}
+	for _, r := range p.Repos {
+		if r == repository {
+			return true
+		}
+	}
+	return false
+}
+
+// PathAllowed reports whether path falls within one of the principal's
+// allowed path prefixes. An empty Paths list is unconstrained.
+func (p *Principal) PathAllowed(path string) bool {
+	if len(p.Paths) == 0 {
+		return true
+	}
+	for _, allowed := range p.Paths {
+		if path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenVerifier validates a JWT bearer token and maps its claims to a Principal
+type TokenVerifier interface {
+	Verify(tokenString string) (*Principal, error)
+}
+
+// NewTokenVerifier builds a TokenVerifier from cfg.TokenVerifier. It returns
+// (nil, nil) when JWT authentication is not configured, so that the frontend
+// can keep offering only the HMAC scheme.
+func NewTokenVerifier(cfg *gw.Config) (TokenVerifier, error) {
+	tc := cfg.TokenVerifier
+	if tc.Issuer == "" {
+		return nil, nil
+	}
+
+	if tc.JWKSURL != "" {
+		return NewJWKSTokenVerifier(tc)
+	}
+
+	if tc.PublicKeyPEM != "" {
+		if key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(tc.PublicKeyPEM)); err == nil {
+			return &staticKeyTokenVerifier{cfg: tc, key: key}, nil
+		}
+		key, err := jwt.ParseECPublicKeyFromPEM([]byte(tc.PublicKeyPEM))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse configured public key as RSA or ECDSA")
+		}
+		return &staticKeyTokenVerifier{cfg: tc, key: key}, nil
+	}
+
+	return nil, errors.New("token verifier requires either jwks_url or a static public_key_pem")
+}
+
+// cvmfsClaims are the custom claims mapped onto a Principal, in addition to
+// the standard registered claims (exp, nbf, aud, sub, iss)
+type cvmfsClaims struct {
+	jwt.StandardClaims
+	Repos []string `json:"cvmfs_repos"`
+	Paths []string `json:"cvmfs_paths"`
+}
+
+func parseAndValidate(tokenString string, keyFunc jwt.Keyfunc, cfg gw.TokenVerifierConfig) (*Principal, error) {
+	claims := &cvmfsClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
+	if err != nil {
+		return nil, errors.Wrap(err, "JWT validation failed")
+	}
+	if !token.Valid {
+		return nil, errors.New("JWT is not valid")
+	}
+	if !claims.VerifyIssuer(cfg.Issuer, true) {
+		return nil, errors.Errorf("unexpected JWT issuer: %v", claims.Issuer)
+	}
+	if cfg.Audience != "" && !claims.VerifyAudience(cfg.Audience, true) {
+		return nil, errors.Errorf("unexpected JWT audience")
+	}
+
+	return &Principal{KeyID: claims.Subject, Repos: claims.Repos, Paths: claims.Paths}, nil
+}
+
+// staticKeyTokenVerifier validates JWTs against a single, pre-configured
+// RSA or ECDSA public key
+type staticKeyTokenVerifier struct {
+	cfg gw.TokenVerifierConfig
+	key interface{}
+}
+
+// Verify implements the TokenVerifier interface
+func (v *staticKeyTokenVerifier) Verify(tokenString string) (*Principal, error) {
+	return parseAndValidate(tokenString, func(*jwt.Token) (interface{}, error) {
+		return v.key, nil
+	}, v.cfg)
+}
+
+// JWKSTokenVerifier validates JWTs against keys fetched from a JWKS endpoint
+// (e.g. Keycloak, Dex, INDIGO IAM), refreshing the key set periodically
+type JWKSTokenVerifier struct {
+	cfg gw.TokenVerifierConfig
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+// NewJWKSTokenVerifier builds a JWKSTokenVerifier from cfg, performing an
+// initial fetch of the key set
+func NewJWKSTokenVerifier(cfg gw.TokenVerifierConfig) (*JWKSTokenVerifier, error) {
+	v := &JWKSTokenVerifier{cfg: cfg}
+	if err := v.refresh(); err != nil {
+		return nil, errors.Wrap(err, "could not fetch initial JWKS")
+	}
+	return v, nil
+}
+
+// Verify implements the TokenVerifier interface
+func (v *JWKSTokenVerifier) Verify(tokenString string) (*Principal, error) {
+	return parseAndValidate(tokenString, v.keyFunc, v.cfg)
+}
+
+func (v *JWKSTokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetched) > v.cfg.JWKSRefresh
+	v.mu.Unlock()
+
+	if !ok || stale {
+		if err := v.refresh(); err != nil {
+			return nil, errors.Wrap(err, "could not refresh JWKS")
+		}
+		v.mu.Lock()
+		key, ok = v.keys[kid]
+		v.mu.Unlock()
+	}
+
+	if !ok {
+		return nil, errors.Errorf("unknown key ID in JWKS: %v", kid)
+	}
+
+	return key, nil
+}
+
+// refresh re-fetches and parses the remote JWKS document, replacing the
+// cached key set on success
+func (v *JWKSTokenVerifier) refresh() error {
+	keys, err := fetchJWKS(v.cfg.JWKSURL)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetched = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
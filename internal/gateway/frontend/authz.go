@@ -1,23 +1,45 @@
 package frontend
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
-	"io"
-	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 
 	gw "github.com/cvmfs/gateway/internal/gateway"
+	"github.com/cvmfs/gateway/internal/gateway/audit"
 	be "github.com/cvmfs/gateway/internal/gateway/backend"
 )
 
-// MakeAuthzMiddleware returns an HMAC authorization middleware for use with the gorilla/mux server
-func MakeAuthzMiddleware(ac *be.AccessConfig) mux.MiddlewareFunc {
+// PreAuthDecisionFrom extracts the PreAuthDecision attached to the request's
+// *Request by MakeAuthzMiddleware, if any
+func PreAuthDecisionFrom(ctx context.Context) (*be.PreAuthDecision, bool) {
+	r, ok := RequestFrom(ctx)
+	if !ok || r.PreAuth == nil {
+		return nil, false
+	}
+	return r.PreAuth, true
+}
+
+// PrincipalFrom extracts the Principal attached to the request's *Request by
+// MakeAuthzMiddleware, if any
+func PrincipalFrom(ctx context.Context) (*be.Principal, bool) {
+	r, ok := RequestFrom(ctx)
+	if !ok || r.Principal == nil {
+		return nil, false
+	}
+	return r.Principal, true
+}
+
+// MakeAuthzMiddleware returns an authorization middleware for use with the gorilla/mux
+// server. It accepts either the legacy "keyID <base64-hmac>" scheme or, when a
+// TokenVerifier is configured, an "Authorization: Bearer <jwt>" header. It must run
+// after MakeRequestMiddleware, which attaches the *Request it reads and enriches.
+func MakeAuthzMiddleware(services *be.Services) mux.MiddlewareFunc {
 	return mux.MiddlewareFunc(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			// GET requests do not need authorization
@@ -26,117 +48,168 @@ func MakeAuthzMiddleware(ac *be.AccessConfig) mux.MiddlewareFunc {
 				return
 			}
 
-			reqID, _ := req.Context().Value(idKey).(uuid.UUID)
-			tokens := strings.Split(req.Header.Get("Authorization"), " ")
-			if len(tokens) != 2 {
-				gw.Log.Error().
-					Str("component", "http").
-					Str("req_id", reqID.String()).
-					Msg("missing tokens in authorization header")
-				replyJSON(&reqID, w, message{"status": "error", "reason": "invalid_hmac"})
-				return
-			}
+			r, _ := RequestFrom(req.Context())
 
-			keyID := tokens[0]
-			HMAC, err := base64.StdEncoding.DecodeString(tokens[1])
-			if err != nil {
-				gw.Log.Error().
-					Str("component", "http").
-					Str("req_id", reqID.String()).
-					Err(err).Msg("could not base64 decode HMAC")
-				replyJSON(&reqID, w, message{"status": "error", "reason": "invalid_hmac"})
-				return
+			auditEntry := &audit.Entry{
+				Time:       time.Now(),
+				RequestID:  r.ID.String(),
+				RemoteAddr: req.RemoteAddr,
+				Method:     req.Method,
+				Path:       req.URL.Path,
+				Repository: r.Repository,
+				LeaseToken: r.LeaseToken,
 			}
-
-			secret := ac.GetSecret(keyID)
-			if len(secret) == 0 {
-				gw.Log.Error().
-					Str("component", "http").
-					Str("req_id", reqID.String()).
-					Msg("invalid key ID specified")
-				replyJSON(&reqID, w, message{"status": "error", "reason": "invalid_hmac"})
-				return
+			r.AuditEntry = auditEntry
+			// Dispatched explicitly at every return below, rather than via a
+			// deferred call, so that it fires before next.ServeHTTP runs: a
+			// deferred WriteRequest would instead run after the downstream
+			// handler - which may itself dispatch auditEntry a second time,
+			// by then fully finalized - producing duplicate audit writes.
+			writeRequestAudit := func() {
+				for _, err := range services.Audit.WriteRequest(req.Context(), auditEntry) {
+					gw.Log.Error().
+						Str("component", "audit").
+						Str("req_id", r.ID.String()).
+						Err(err).Msg("could not write audit entry")
+				}
 			}
 
-			// Different parts of the request are used to compute then HMAC, depending
-			// in HTTP method and route
-
-			var HMACInput []byte
-			if strings.HasPrefix(req.URL.Path, APIRoot+"/leases") {
-				token, _ := mux.Vars(req)["token"]
-				if token != "" {
-					// For commit/drop lease requests use the token to compute HMAC
-					HMACInput = []byte(token)
-				} else {
-					// For new lease request used the request body to compute HMAC
-					HMACInput, err = ioutil.ReadAll(req.Body)
-					if err != nil {
-						httpWrapError(&reqID, err, "could not read request body", w, http.StatusInternalServerError)
-						return
-					}
-					// Body needs to be read again in the next handler, reset it
-					// using a copy of the original body
-					bodyCopy := ioutil.NopCloser(bytes.NewReader(HMACInput))
-					req.Body.Close()
-					req.Body = bodyCopy
+			var principal *be.Principal
+			if services.Tokens != nil && strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+				p, err := authenticateJWT(services, req)
+				if err != nil {
+					gw.Log.Error().
+						Str("component", "http").
+						Str("req_id", r.ID.String()).
+						Err(err).Msg("JWT authentication failed")
+					auditEntry.Result = "invalid_jwt"
+					writeRequestAudit()
+					replyJSON(&r.ID, w, message{"status": "error", "reason": "invalid_jwt"})
+					return
 				}
-			} else if strings.HasPrefix(req.URL.Path, APIRoot+"/payloads") {
-				token, _ := mux.Vars(req)["token"]
-				if token != "" {
-					// For the new style of payload submission requests, use the token to compute HMAC
-					HMACInput = []byte(token)
-				} else {
-					// For legacy payload submission requests, the JSON msg at the beginning of the body
-					// is used to compute the HMAC
-					msgSize, err := strconv.Atoi(req.Header.Get("message-size"))
-					if err != nil {
-						httpWrapError(&reqID, err, "missing message-size header", w, http.StatusBadRequest)
-						return
-					}
-					msgRdr := io.LimitReader(req.Body, int64(msgSize))
-					msg, err := ioutil.ReadAll(msgRdr)
-					if err != nil {
-						httpWrapError(&reqID, err, "invalid request body", w, http.StatusBadRequest)
-						return
-					}
-
-					HMACInput = msg
-
-					// replace the request body with a new ReadCLoser which includes the already-read
-					// head part
-					req.Body = newRecombineReadCloser(msg, req.Body)
+				auditEntry.KeyID = services.Audit.HashKeyID(p.KeyID)
+				principal = p
+			} else {
+				p, err := authenticateHMAC(services, r, req, w, auditEntry)
+				if err != nil {
+					auditEntry.Result = "invalid_hmac"
+					writeRequestAudit()
+					return
 				}
+				principal = p
+				auditEntry.HMACValid = true
 			}
 
-			if !CheckHMAC(HMACInput, HMAC, secret) {
+			r.Principal = principal
+
+			// A JWT principal may itself carry repository/path constraints
+			// (the HMAC scheme has none - the AccessConfig entry for KeyID
+			// already encodes them). Enforce those before even asking the
+			// external pre-authorizer, for the same new-lease case where a
+			// real repository path is available to check.
+			if r.Repository != "" && (!principal.RepoAllowed(r.Repository) || !principal.PathAllowed(r.LeasePath)) {
+				auditEntry.Result = "not_authorized"
+				writeRequestAudit()
+				replyJSON(&r.ID, w, message{"status": "error", "reason": "not_authorized"})
+				return
+			}
+
+			decision, err := services.PreAuth.Authorize(be.PreAuthRequest{
+				Method:     req.Method,
+				Repository: r.Repository,
+				Path:       req.URL.Path,
+				KeyID:      principal.KeyID,
+				LeasePath:  r.LeasePath,
+				RequestID:  r.ID.String(),
+			})
+			if err == nil && decision == nil {
+				err = errors.New("pre-authorizer returned no decision")
+			}
+			if err != nil {
 				gw.Log.Error().
 					Str("component", "http").
-					Str("req_id", reqID.String()).
-					Msg("invalid HMAC")
-				replyJSON(&reqID, w, message{"status": "error", "reason": "invalid_hmac"})
+					Str("req_id", r.ID.String()).
+					Err(err).Msg("pre-authorization denied")
+				auditEntry.Result = "not_authorized"
+				writeRequestAudit()
+				replyJSON(&r.ID, w, message{"status": "error", "reason": "not_authorized"})
 				return
 			}
+			r.PreAuth = decision
+
+			// Enforce the granted path constraint here whenever we actually have
+			// a repository path to check it against - i.e. for new-lease
+			// requests. For commit/drop/renew, r.LeasePath is only the opaque
+			// lease token. Of those, only the renew handler checks the lease's
+			// resolved path against r.PreAuth; commit and drop do not.
+			if r.Repository != "" && !decision.PathAllowed(r.LeasePath) {
+				auditEntry.Result = "not_authorized"
+				writeRequestAudit()
+				replyJSON(&r.ID, w, message{"status": "error", "reason": "not_authorized"})
+				return
+			}
+
+			auditEntry.Result = "authorized"
+			writeRequestAudit()
 			next.ServeHTTP(w, req)
 		})
 	})
 }
 
-// The recombineReadCloser is used during payload submission requests to recombine the request message,
-// already read inside the authorization middleware with the remaining request body and ensure that the
-// body (io.ReadCloser) is eventually closed and does not leak
-type recombineReadCloser struct {
-	combined io.Reader
-	original io.ReadCloser
-}
-
-func newRecombineReadCloser(head []byte, tail io.ReadCloser) *recombineReadCloser {
-	return &recombineReadCloser{io.MultiReader(bytes.NewReader(head), tail), tail}
-}
-
-func (r recombineReadCloser) Read(p []byte) (int, error) {
-	return r.combined.Read(p)
+// authenticateJWT validates the Bearer token carried by req and maps it to a Principal
+func authenticateJWT(services *be.Services, req *http.Request) (*be.Principal, error) {
+	tokenString := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return services.Tokens.Verify(tokenString)
 }
 
-func (r recombineReadCloser) Close() error {
-	return r.original.Close()
+// authenticateHMAC validates the legacy "keyID <base64-hmac>" scheme carried by
+// req, using the HMAC input already computed into r by MakeRequestMiddleware.
+// It writes an error response and returns a non-nil error if authentication fails.
+// auditEntry.KeyID is populated as soon as a key ID can be parsed out of the
+// header, so that the audit trail identifies the key even when authentication
+// goes on to fail.
+func authenticateHMAC(services *be.Services, r *Request, req *http.Request, w http.ResponseWriter, auditEntry *audit.Entry) (*be.Principal, error) {
+	tokens := strings.Split(req.Header.Get("Authorization"), " ")
+	if len(tokens) != 2 {
+		gw.Log.Error().
+			Str("component", "http").
+			Str("req_id", r.ID.String()).
+			Msg("missing tokens in authorization header")
+		replyJSON(&r.ID, w, message{"status": "error", "reason": "invalid_hmac"})
+		return nil, errors.New("missing tokens in authorization header")
+	}
+
+	keyID := tokens[0]
+	auditEntry.KeyID = services.Audit.HashKeyID(keyID)
+
+	HMAC, err := base64.StdEncoding.DecodeString(tokens[1])
+	if err != nil {
+		gw.Log.Error().
+			Str("component", "http").
+			Str("req_id", r.ID.String()).
+			Err(err).Msg("could not base64 decode HMAC")
+		replyJSON(&r.ID, w, message{"status": "error", "reason": "invalid_hmac"})
+		return nil, err
+	}
+
+	secret := services.Secrets.GetSecret(keyID)
+	if len(secret) == 0 {
+		gw.Log.Error().
+			Str("component", "http").
+			Str("req_id", r.ID.String()).
+			Msg("invalid key ID specified")
+		replyJSON(&r.ID, w, message{"status": "error", "reason": "invalid_hmac"})
+		return nil, errors.New("invalid key ID specified")
+	}
+
+	if !CheckHMAC(r.HMACInput, HMAC, secret) {
+		gw.Log.Error().
+			Str("component", "http").
+			Str("req_id", r.ID.String()).
+			Msg("invalid HMAC")
+		replyJSON(&r.ID, w, message{"status": "error", "reason": "invalid_hmac"})
+		return nil, errors.New("invalid HMAC")
+	}
+
+	return &be.Principal{KeyID: keyID}, nil
 }
@@ -0,0 +1,141 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	gw "github.com/cvmfs/gateway/internal/gateway"
+	"github.com/cvmfs/gateway/internal/gateway/audit"
+	be "github.com/cvmfs/gateway/internal/gateway/backend"
+)
+
+// renewLeaseRequest is the JSON body accepted by the lease renewal endpoint
+type renewLeaseRequest struct {
+	// Extend is the requested additional lifetime of the lease, e.g. "2m30s".
+	// If omitted, the server's default lease extension is used.
+	Extend string `json:"extend"`
+}
+
+// MakeLeaseRenewHandler returns the handler for
+// POST /api/v1/leases/{token}/renew, which atomically extends the
+// expiration of an existing lease
+func MakeLeaseRenewHandler(services *be.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r, _ := RequestFrom(req.Context())
+		token := r.LeaseToken
+
+		// Reuse the entry the authz middleware already built and dispatched
+		// a WriteRequest for, so this handler's outcome lands on the same,
+		// complete entry (KeyID, HMACValid, ...) instead of a second,
+		// partially-populated one.
+		auditEntry := r.AuditEntry
+		if auditEntry == nil {
+			auditEntry = &audit.Entry{
+				Time:       time.Now(),
+				RequestID:  r.ID.String(),
+				RemoteAddr: req.RemoteAddr,
+				Method:     req.Method,
+				Path:       req.URL.Path,
+				LeaseToken: token,
+			}
+		}
+		defer func() {
+			for _, err := range services.Audit.WriteResponse(req.Context(), auditEntry) {
+				gw.Log.Error().
+					Str("component", "audit").
+					Str("req_id", r.ID.String()).
+					Err(err).Msg("could not write audit entry")
+			}
+		}()
+
+		renewable, ok := services.Leases.(be.RenewableLeaseDB)
+		if !ok {
+			gw.Log.Error().
+				Str("component", "http").
+				Str("req_id", r.ID.String()).
+				Msg("configured lease DB does not support renewal")
+			auditEntry.Result = "not_renewable"
+			replyJSON(&r.ID, w, message{"status": "error", "reason": "not_renewable"})
+			return
+		}
+
+		var body renewLeaseRequest
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				httpWrapError(&r.ID, err, "invalid request body", w, http.StatusBadRequest)
+				return
+			}
+		}
+
+		extend := gw.DefaultLeaseRenewal
+		if body.Extend != "" {
+			d, err := time.ParseDuration(body.Extend)
+			if err != nil {
+				httpWrapError(&r.ID, err, "invalid extend duration", w, http.StatusBadRequest)
+				return
+			}
+			extend = d
+		}
+
+		// Resolve the lease's real path now that the token can be used to
+		// look it up, and re-check it against the same constraints the
+		// new-lease path already enforces in MakeAuthzMiddleware: the JWT
+		// principal's scope and the external pre-authorizer's decision.
+		// Neither could be checked against this lease's actual repository at
+		// authz time, since only the opaque token was available then.
+		if path, err := renewable.LeasePath(token); err == nil {
+			repository := repositoryFromLeasePath(path)
+			auditEntry.Repository = repository
+			if r.Principal != nil && (!r.Principal.RepoAllowed(repository) || !r.Principal.PathAllowed(path)) {
+				auditEntry.Result = "not_authorized"
+				replyJSON(&r.ID, w, message{"status": "error", "reason": "not_authorized"})
+				return
+			}
+			if r.PreAuth != nil && !r.PreAuth.PathAllowed(path) {
+				auditEntry.Result = "not_authorized"
+				replyJSON(&r.ID, w, message{"status": "error", "reason": "not_authorized"})
+				return
+			}
+
+			// Cap the requested extension against the configured renewal
+			// policy, keyed by the now-resolved repository.
+			if services.RenewalPolicy != nil {
+				if max := services.RenewalPolicy.MaxLifetimeFor(repository); max > 0 && extend > max {
+					extend = max
+				}
+			}
+		} else {
+			gw.Log.Error().
+				Str("component", "http").
+				Str("req_id", r.ID.String()).
+				Err(err).Msg("could not resolve lease path")
+			auditEntry.Result = "not_renewable"
+			replyJSON(&r.ID, w, message{"status": "error", "reason": "not_renewable"})
+			return
+		}
+
+		if err := renewable.RenewLease(token, extend); err != nil {
+			gw.Log.Error().
+				Str("component", "http").
+				Str("req_id", r.ID.String()).
+				Err(err).Msg("could not renew lease")
+			auditEntry.Result = "not_renewable"
+			replyJSON(&r.ID, w, message{"status": "error", "reason": "not_renewable"})
+			return
+		}
+
+		auditEntry.Result = "renewed"
+		replyJSON(&r.ID, w, message{"status": "ok"})
+	}
+}
+
+// RegisterLeaseRenewRoute mounts the lease renewal endpoint on router. It
+// should be called alongside the gateway's other route registrations (where
+// POST /api/v1/leases/{token} and .../commit are already mounted), behind
+// the same MakeRequestMiddleware/MakeAuthzMiddleware chain.
+func RegisterLeaseRenewRoute(router *mux.Router, services *be.Services) {
+	router.HandleFunc(APIRoot+"/leases/{token}/renew", MakeLeaseRenewHandler(services)).Methods(http.MethodPost)
+}
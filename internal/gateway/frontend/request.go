@@ -0,0 +1,181 @@
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/cvmfs/gateway/internal/gateway/audit"
+	be "github.com/cvmfs/gateway/internal/gateway/backend"
+)
+
+// Request bundles everything handlers need to know about an inbound
+// request. It is built once, by MakeRequestMiddleware, instead of being
+// re-derived ad hoc from raw headers and scattered context.WithValue calls
+// further down the middleware chain. The new-lease body and the legacy
+// payload's leading message are read here, then re-attached to req.Body
+// (the message in front of the remaining payload), so the handler that
+// consumes them reads them again from req.Body.
+type Request struct {
+	// ID is this request's unique identifier, used throughout logging and
+	// audit entries
+	ID uuid.UUID
+
+	// LeaseToken is the {token} path variable, when the route carries one
+	LeaseToken string
+
+	// LeasePath is the repository path this request concerns. For a new-lease
+	// request it is recovered from the request body; for commit/drop/renew
+	// requests the lease token stands in for it, since those requests don't
+	// carry the path directly and resolving the token to its path would
+	// require a lease store lookup this middleware doesn't have.
+	LeasePath string
+
+	// Repository is the repository name - the leading path component of
+	// LeasePath - when it could be determined from the request body. It is
+	// left empty for commit/drop/renew requests, where LeasePath is only the
+	// opaque lease token.
+	Repository string
+
+	// HMACInput is the slice of the request used to compute/verify the
+	// legacy HMAC scheme: the lease token, the new-lease request body, or
+	// (for legacy payload submission) the leading JSON message
+	HMACInput []byte
+
+	// MessageHeader is the legacy payload submission's leading JSON message,
+	// as read by MakeRequestMiddleware. The same bytes are also re-attached
+	// in front of the remaining req.Body.
+	MessageHeader []byte
+
+	// Principal is filled in by the authz middleware once the request has
+	// been authenticated, via either the HMAC or the JWT scheme
+	Principal *be.Principal
+
+	// PreAuth is filled in by the authz middleware with the decision
+	// returned by the configured PreAuthorizer
+	PreAuth *be.PreAuthDecision
+
+	// AuditEntry is the audit.Entry built and dispatched by the authz
+	// middleware once the request has been authenticated (or rejected).
+	// Handlers that need to record the outcome of the operation itself
+	// should update this entry's Result rather than building their own, so
+	// that a single, complete entry is ever dispatched per request.
+	AuditEntry *audit.Entry
+}
+
+type requestKeyType struct{}
+
+var requestKey = requestKeyType{}
+
+// RequestFrom extracts the *Request built by MakeRequestMiddleware from ctx
+func RequestFrom(ctx context.Context) (*Request, bool) {
+	r, ok := ctx.Value(requestKey).(*Request)
+	return r, ok
+}
+
+// MakeRequestMiddleware returns the entry middleware that parses each
+// request exactly once and attaches the result to the request context as a
+// *Request. It must run before MakeAuthzMiddleware, which enriches the same
+// struct with the authenticated Principal and PreAuthDecision.
+func MakeRequestMiddleware() mux.MiddlewareFunc {
+	return mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r := &Request{ID: uuid.New()}
+			ctx := context.WithValue(req.Context(), idKey, r.ID)
+			ctx = context.WithValue(ctx, requestKey, r)
+			req = req.WithContext(ctx)
+
+			if req.Method == http.MethodGet {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			r.LeaseToken, _ = mux.Vars(req)["token"]
+
+			var err error
+			if r.LeaseToken != "" {
+				// For commit/drop lease and new-style payload submission requests,
+				// use the lease token to compute the HMAC
+				r.HMACInput = []byte(r.LeaseToken)
+				r.LeasePath = r.LeaseToken
+			} else if strings.HasPrefix(req.URL.Path, APIRoot+"/leases") {
+				// For new lease requests, use the request body to compute the HMAC
+				r.HMACInput, err = ioutil.ReadAll(req.Body)
+				if err != nil {
+					httpWrapError(&r.ID, err, "could not read request body", w, http.StatusInternalServerError)
+					return
+				}
+				req.Body.Close()
+				req.Body = ioutil.NopCloser(bytes.NewReader(r.HMACInput))
+
+				var body newLeaseRequest
+				if err := json.Unmarshal(r.HMACInput, &body); err == nil {
+					r.LeasePath = body.Path
+					r.Repository = repositoryFromLeasePath(body.Path)
+				}
+			} else if strings.HasPrefix(req.URL.Path, APIRoot+"/payloads") {
+				// For legacy payload submission requests, the JSON message at the
+				// beginning of the body is used to compute the HMAC
+				msgSize, err := strconv.Atoi(req.Header.Get("message-size"))
+				if err != nil {
+					httpWrapError(&r.ID, err, "missing message-size header", w, http.StatusBadRequest)
+					return
+				}
+				msg, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(msgSize)))
+				if err != nil {
+					httpWrapError(&r.ID, err, "invalid request body", w, http.StatusBadRequest)
+					return
+				}
+
+				r.HMACInput = msg
+				r.MessageHeader = msg
+				// Re-attach the already-read message header in front of the
+				// remaining body, so the handler sees the full original payload
+				req.Body = newRecombineReadCloser(msg, req.Body)
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	})
+}
+
+// newLeaseRequest is the JSON body of a new-lease request, just enough of it
+// to recover the repository and path the lease is being requested against
+type newLeaseRequest struct {
+	Path string `json:"path"`
+}
+
+// repositoryFromLeasePath returns the repository name - the leading path
+// component - of a lease path of the form "repo.domain/sub/dir"
+func repositoryFromLeasePath(path string) string {
+	return strings.SplitN(path, "/", 2)[0]
+}
+
+// recombineReadCloser is used during legacy payload submission requests to
+// recombine the leading message, already read by MakeRequestMiddleware, with
+// the remaining request body, ensuring that the body (io.ReadCloser) is
+// eventually closed and does not leak
+type recombineReadCloser struct {
+	combined io.Reader
+	original io.ReadCloser
+}
+
+func newRecombineReadCloser(head []byte, tail io.ReadCloser) *recombineReadCloser {
+	return &recombineReadCloser{io.MultiReader(bytes.NewReader(head), tail), tail}
+}
+
+func (r recombineReadCloser) Read(p []byte) (int, error) {
+	return r.combined.Read(p)
+}
+
+func (r recombineReadCloser) Close() error {
+	return r.original.Close()
+}
@@ -0,0 +1,28 @@
+package frontend
+
+import "net/http"
+
+// forwardableHeaders is the explicit allow-list of headers that
+// SanitizeHeaders copies onto a request towards an upstream service
+// (release-manager notifications, receiver hooks). Everything else - in
+// particular Authorization and Cookie - is dropped, mirroring how
+// gitlab-workhorse builds a clean upstream request rather than blindly
+// relaying the inbound one. Nothing in this package calls SanitizeHeaders;
+// an upstream request is filtered only where the code building it does.
+var forwardableHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"User-Agent",
+	"X-Request-Id",
+}
+
+// SanitizeHeaders copies only the allow-listed headers from src into dst,
+// leaving everything else - including any inbound Authorization or Cookie
+// header - behind
+func SanitizeHeaders(dst, src http.Header) {
+	for _, name := range forwardableHeaders {
+		if v := src.Get(name); v != "" {
+			dst.Set(name, v)
+		}
+	}
+}